@@ -0,0 +1,193 @@
+/*
+Copyright (c) 2018 Forrest Sibley <My^Name^Without^The^Surname@ieee.org>
+
+Permission is hereby granted, free of charge, to any person obtaining
+a copy of this software and associated documentation files (the
+"Software"), to deal in the Software without restriction, including
+without limitation the rights to use, copy, modify, merge, publish,
+distribute, sublicense, and/or sell copies of the Software, and to
+permit persons to whom the Software is furnished to do so, subject to
+the following conditions:
+
+The above copyright notice and this permission notice shall be
+included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package sysfsGPIO
+
+import (
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// pinFile is the subset of *os.File that the sysfs backend needs from an open gpioN/value file.
+type pinFile interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+}
+
+// Backend abstracts the filesystem calls that the sysfs backend makes against /sys/class/gpio, so that it can be
+// pointed at something other than the real filesystem. The default Backend, used unless SetBackend is called, is
+// a thin wrapper around the os package. MemBackend is the in-memory alternative intended for tests.
+type Backend interface {
+	WriteFile(name string, data []byte, perm os.FileMode) error
+	OpenFile(name string, flag int, perm os.FileMode) (pinFile, error)
+	Stat(name string) (os.FileInfo, error)
+}
+
+// osBackend is the default Backend, implemented directly on top of the os package.
+type osBackend struct{}
+
+func (osBackend) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+
+func (osBackend) OpenFile(name string, flag int, perm os.FileMode) (pinFile, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (osBackend) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// backend is the Backend currently in effect. It defaults to the real filesystem.
+var backend Backend = osBackend{}
+
+// SetBackend overrides the Backend used by InitPin from this point on. A sysfs pin created earlier keeps its value
+// file open on the Backend it was created with, but its later edge, active_low, direction and unexport writes go
+// through whichever Backend is current at the time. Passing nil restores the default, real-filesystem Backend.
+// This exists for tests: see MemBackend.
+func SetBackend(b Backend) {
+	if b == nil {
+		b = osBackend{}
+	}
+	backend = b
+}
+
+// memFakeFDs hands out unique negative "file descriptors" to memFile handles, so that several mem-backed pins can
+// be tracked independently by a Poller without colliding with each other or with real (non-negative) fds.
+var memFakeFDs int32
+
+// memFile is one named file in a MemBackend: its entire contents, Unix-style.
+type memFile struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+// memFileHandle is one open handle onto a memFile, with its own read offset, mirroring os.File.
+type memFileHandle struct {
+	file   *memFile
+	offset int
+	fakeFD int
+}
+
+func (h *memFileHandle) Write(p []byte) (int, error) {
+	h.file.mu.Lock()
+	h.file.data = append([]byte(nil), p...)
+	h.file.mu.Unlock()
+	h.offset = 0
+	return len(p), nil
+}
+
+func (h *memFileHandle) Read(p []byte) (int, error) {
+	h.file.mu.Lock()
+	defer h.file.mu.Unlock()
+	if h.offset >= len(h.file.data) {
+		return 0, io.EOF
+	}
+	n := copy(p, h.file.data[h.offset:])
+	h.offset += n
+	return n, nil
+}
+
+func (h *memFileHandle) Seek(offset int64, whence int) (int64, error) {
+	h.offset = int(offset)
+	return offset, nil
+}
+
+func (h *memFileHandle) Close() error {
+	return nil
+}
+
+// FakeFD reports this handle's synthetic file descriptor, which sysfsBackend.fd() falls back to when the
+// underlying pinFile is not a real *os.File (i.e. when running against a MemBackend).
+func (h *memFileHandle) FakeFD() int {
+	return h.fakeFD
+}
+
+// MemBackend is an in-memory Backend for use in tests: it keeps every pin's sysfs attribute files (direction,
+// edge, active_low, value, ...) as in-memory buffers, so InitPin, SetTriggerEdge, Read, SetHigh/SetLow,
+// AddPinInterrupt, and DeletePinInterrupt can all be exercised without root or real GPIO hardware. Use
+// SetBackend(NewMemBackend()) to install one.
+type MemBackend struct {
+	mu    sync.Mutex
+	files map[string]*memFile
+}
+
+// NewMemBackend returns an empty MemBackend.
+func NewMemBackend() *MemBackend {
+	return &MemBackend{files: make(map[string]*memFile)}
+}
+
+func (m *MemBackend) file(name string) *memFile {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.files[name]
+	if !ok {
+		f = &memFile{}
+		m.files[name] = f
+	}
+	return f
+}
+
+func (m *MemBackend) WriteFile(name string, data []byte, perm os.FileMode) error {
+	f := m.file(name)
+	f.mu.Lock()
+	f.data = append([]byte(nil), data...)
+	f.mu.Unlock()
+	return nil
+}
+
+func (m *MemBackend) OpenFile(name string, flag int, perm os.FileMode) (pinFile, error) {
+	return &memFileHandle{file: m.file(name), fakeFD: int(atomic.AddInt32(&memFakeFDs, -1))}, nil
+}
+
+func (m *MemBackend) Stat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	_, ok := m.files[name]
+	m.mu.Unlock()
+
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	// No caller in this package inspects the returned os.FileInfo - only the error - so a nil value is enough.
+	return nil, nil
+}
+
+// Get returns the current contents of a simulated sysfs attribute file, for use in test assertions. It returns
+// ("", false) if the file has never been written.
+func (m *MemBackend) Get(name string) (string, bool) {
+	m.mu.Lock()
+	f, ok := m.files[name]
+	m.mu.Unlock()
+	if !ok {
+		return "", false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return string(f.data), true
+}
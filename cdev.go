@@ -0,0 +1,400 @@
+/*
+Copyright (c) 2018 Forrest Sibley <My^Name^Without^The^Surname@ieee.org>
+
+Permission is hereby granted, free of charge, to any person obtaining
+a copy of this software and associated documentation files (the
+"Software"), to deal in the Software without restriction, including
+without limitation the rights to use, copy, modify, merge, publish,
+distribute, sublicense, and/or sell copies of the Software, and to
+permit persons to whom the Software is furnished to do so, subject to
+the following conditions:
+
+The above copyright notice and this permission notice shall be
+included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package sysfsGPIO
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// This file talks to the modern /dev/gpiochipN character device (the GPIO_V2_LINE uAPI) instead of the deprecated
+// /sys/class/gpio tree. golang.org/x/sys/unix does not (yet) expose the GPIO ioctl numbers or structs, so they are
+// reproduced here from <linux/gpio.h>. The struct layouts and ioctl numbers must match the kernel header exactly;
+// see https://www.kernel.org/doc/html/latest/userspace-api/gpio/chardev-interface.html.
+
+const (
+	gpioMaxNameSize       = 32
+	gpioV2LinesMax        = 64
+	gpioV2LineNumAttrsMax = 10
+)
+
+// Line flags, mirroring enum gpio_v2_line_flag.
+const (
+	gpioV2LineFlagUsed         = uint64(1) << 0
+	gpioV2LineFlagActiveLow    = uint64(1) << 1
+	gpioV2LineFlagInput        = uint64(1) << 2
+	gpioV2LineFlagOutput       = uint64(1) << 3
+	gpioV2LineFlagEdgeRising   = uint64(1) << 4
+	gpioV2LineFlagEdgeFalling  = uint64(1) << 5
+	gpioV2LineFlagOpenDrain    = uint64(1) << 6
+	gpioV2LineFlagOpenSource   = uint64(1) << 7
+	gpioV2LineFlagBiasPullUp   = uint64(1) << 8
+	gpioV2LineFlagBiasPullDown = uint64(1) << 9
+	gpioV2LineFlagBiasDisabled = uint64(1) << 10
+	gpioV2LineFlagEventClock   = uint64(1) << 11
+)
+
+// Line attribute kinds, mirroring enum gpio_v2_line_attr_id.
+const (
+	gpioV2LineAttrIDFlags        = 1
+	gpioV2LineAttrIDOutputValues = 2
+	gpioV2LineAttrIDDebounce     = 3
+)
+
+type gpioV2LineValues struct {
+	Bits uint64
+	Mask uint64
+}
+
+type gpioV2LineAttribute struct {
+	ID    uint32
+	_     uint32
+	Value uint64
+}
+
+type gpioV2LineConfigAttribute struct {
+	Attr gpioV2LineAttribute
+	Mask uint64
+}
+
+type gpioV2LineConfig struct {
+	Flags    uint64
+	NumAttrs uint32
+	_        [5]uint32
+	Attrs    [gpioV2LineNumAttrsMax]gpioV2LineConfigAttribute
+}
+
+type gpioV2LineRequest struct {
+	Offsets         [gpioV2LinesMax]uint32
+	Consumer        [gpioMaxNameSize]byte
+	Config          gpioV2LineConfig
+	NumLines        uint32
+	EventBufferSize uint32
+	_               [5]uint32
+	Fd              int32
+}
+
+type gpioV2LineInfo struct {
+	Name     [gpioMaxNameSize]byte
+	Consumer [gpioMaxNameSize]byte
+	Offset   uint32
+	NumAttrs uint32
+	Flags    uint64
+	Attrs    [gpioV2LineNumAttrsMax]gpioV2LineAttribute
+	_        [4]uint32
+}
+
+type gpioV2LineEvent struct {
+	Timestamp uint64
+	ID        uint32
+	Offset    uint32
+	Seqno     uint32
+	LineSeqno uint32
+	_         [6]uint32
+}
+
+// ioctl number construction, matching the _IOC macro in <asm-generic/ioctl.h>.
+const (
+	iocNRBits   = 8
+	iocTypeBits = 8
+	iocSizeBits = 14
+
+	iocNRShift   = 0
+	iocTypeShift = iocNRShift + iocNRBits
+	iocSizeShift = iocTypeShift + iocTypeBits
+	iocDirShift  = iocSizeShift + iocSizeBits
+
+	iocRead  = uintptr(2)
+	iocWrite = uintptr(1)
+)
+
+func ioc(dir, typ, nr, size uintptr) uintptr {
+	return (dir << iocDirShift) | (typ << iocTypeShift) | (nr << iocNRShift) | (size << iocSizeShift)
+}
+
+func iowr(typ, nr uintptr, size uintptr) uintptr {
+	return ioc(iocRead|iocWrite, typ, nr, size)
+}
+
+// gpioIoctlType is the ioctl magic number the kernel registers the GPIO character device under (see
+// <linux/gpio.h>: _IOWR(0xB4, ...)). It is not the ASCII code for 'B'.
+const gpioIoctlType = uintptr(0xB4)
+
+var (
+	gpioV2GetLineIoctl       = iowr(gpioIoctlType, 0x07, unsafe.Sizeof(gpioV2LineRequest{}))
+	gpioV2LineInfoIoctl      = iowr(gpioIoctlType, 0x05, unsafe.Sizeof(gpioV2LineInfo{}))
+	gpioV2LineSetConfigIoctl = iowr(gpioIoctlType, 0x0d, unsafe.Sizeof(gpioV2LineConfig{}))
+	gpioV2LineGetValuesIoctl = iowr(gpioIoctlType, 0x0e, unsafe.Sizeof(gpioV2LineValues{}))
+	gpioV2LineSetValuesIoctl = iowr(gpioIoctlType, 0x0f, unsafe.Sizeof(gpioV2LineValues{}))
+)
+
+func ioctl(fd uintptr, req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// cdevBackend implements pinBackend on top of a /dev/gpiochipN line request fd.
+type cdevBackend struct {
+	chip   *os.File
+	lineFd int
+	offset uint32
+	// flags mirrors the line's current configuration so that partial updates (edge, active-low, bias, drive) can
+	// be merged and pushed together via GPIO_V2_LINE_SET_CONFIG_IOCTL without clobbering unrelated settings.
+	flags uint64
+}
+
+func (b *cdevBackend) setConfig(flags uint64) error {
+	config := gpioV2LineConfig{Flags: flags}
+	if err := ioctl(uintptr(b.lineFd), gpioV2LineSetConfigIoctl, unsafe.Pointer(&config)); err != nil {
+		return err
+	}
+	b.flags = flags
+	return nil
+}
+
+func (b *cdevBackend) setHigh() error {
+	return b.setValue(1)
+}
+
+func (b *cdevBackend) setLow() error {
+	return b.setValue(0)
+}
+
+func (b *cdevBackend) setValue(bit uint64) error {
+	values := gpioV2LineValues{Bits: bit, Mask: 1}
+	return ioctl(uintptr(b.lineFd), gpioV2LineSetValuesIoctl, unsafe.Pointer(&values))
+}
+
+func (b *cdevBackend) read() (int, error) {
+	values := gpioV2LineValues{Mask: 1}
+	if err := ioctl(uintptr(b.lineFd), gpioV2LineGetValuesIoctl, unsafe.Pointer(&values)); err != nil {
+		return -1, err
+	}
+	return int(values.Bits & 1), nil
+}
+
+// setTriggerEdge reconfigures the line's edge-detection flags in place via GPIO_V2_LINE_SET_CONFIG_IOCTL, leaving
+// every other flag (active-low, bias, drive) untouched.
+func (b *cdevBackend) setTriggerEdge(edge string) error {
+	flags := b.flags &^ (gpioV2LineFlagEdgeRising | gpioV2LineFlagEdgeFalling)
+	switch edge {
+	case "rising":
+		flags |= gpioV2LineFlagEdgeRising
+	case "falling":
+		flags |= gpioV2LineFlagEdgeFalling
+	case "both":
+		flags |= gpioV2LineFlagEdgeRising | gpioV2LineFlagEdgeFalling
+	case "none":
+	default:
+		return errors.New("Error: Invalid trigger edge specified")
+	}
+
+	return b.setConfig(flags)
+}
+
+// setActiveLow flips the GPIO_V2_LINE_FLAG_ACTIVE_LOW bit, leaving every other flag untouched.
+func (b *cdevBackend) setActiveLow(activeLow bool) error {
+	flags := b.flags &^ gpioV2LineFlagActiveLow
+	if activeLow {
+		flags |= gpioV2LineFlagActiveLow
+	}
+	return b.setConfig(flags)
+}
+
+// setBias replaces the bias flags (pull-up/pull-down/disabled) with the requested one.
+func (b *cdevBackend) setBias(bias Bias) error {
+	flags := b.flags &^ (gpioV2LineFlagBiasPullUp | gpioV2LineFlagBiasPullDown | gpioV2LineFlagBiasDisabled)
+	switch bias {
+	case BiasPullUp:
+		flags |= gpioV2LineFlagBiasPullUp
+	case BiasPullDown:
+		flags |= gpioV2LineFlagBiasPullDown
+	case BiasDisabled:
+		flags |= gpioV2LineFlagBiasDisabled
+	default:
+		return errors.New("sysfsGPIO: invalid bias")
+	}
+	return b.setConfig(flags)
+}
+
+// setDrive replaces the output drive flags (push-pull/open-drain/open-source) with the requested one.
+func (b *cdevBackend) setDrive(drive Drive) error {
+	flags := b.flags &^ (gpioV2LineFlagOpenDrain | gpioV2LineFlagOpenSource)
+	switch drive {
+	case DrivePushPull:
+	case DriveOpenDrain:
+		flags |= gpioV2LineFlagOpenDrain
+	case DriveOpenSource:
+		flags |= gpioV2LineFlagOpenSource
+	default:
+		return errors.New("sysfsGPIO: invalid drive mode")
+	}
+	return b.setConfig(flags)
+}
+
+// eventTimestamps drains every gpio_v2_line_event currently queued on the line fd and returns their
+// kernel-provided CLOCK_MONOTONIC timestamps, in order. It is called from the Poller's goroutine right after epoll
+// reports the line fd as readable. The line fd is opened non-blocking (see NewCdevPin), so the final read that
+// finds nothing left to drain returns EAGAIN instead of blocking; if no event could be read at all, it falls back
+// to a single current-time entry so the caller still dispatches something.
+func (b *cdevBackend) eventTimestamps() ([]time.Time, error) {
+	var timestamps []time.Time
+
+	var event gpioV2LineEvent
+	buf := (*[unsafe.Sizeof(event)]byte)(unsafe.Pointer(&event))[:]
+	for {
+		n, err := unix.Read(b.lineFd, buf)
+		if err != nil {
+			break
+		}
+		if n != len(buf) {
+			break
+		}
+		timestamps = append(timestamps, time.Unix(0, int64(event.Timestamp)))
+	}
+
+	if len(timestamps) == 0 {
+		return []time.Time{time.Now()}, nil
+	}
+	return timestamps, nil
+}
+
+func (b *cdevBackend) fd() int {
+	return b.lineFd
+}
+
+// release closes the line request fd and the chip file. A cdev line has no sysfs directory entry to un-export.
+func (b *cdevBackend) release() error {
+	unix.Close(b.lineFd)
+	return b.chip.Close()
+}
+
+// NewCdevPin requests a single line from /dev/gpiochipN (e.g. "gpiochip0") via the GPIO_V2_LINE uAPI, and returns an
+// *IOPin that behaves the same as one created by InitPin. The fd behind the returned line request can be added to
+// the package's epoll loop with AddPinInterrupt, the same as a sysfs pin.
+func NewCdevPin(chip string, line int, dir Direction) (*IOPin, error) {
+	chipPath := "/dev/" + chip
+	chipFile, err := os.OpenFile(chipPath, os.O_RDWR, 0660)
+	if err != nil {
+		return nil, err
+	}
+
+	var flags uint64
+	var directionString string
+	if dir == DirectionOutput {
+		flags = gpioV2LineFlagOutput
+		directionString = "out"
+	} else {
+		flags = gpioV2LineFlagInput
+		directionString = "in"
+	}
+
+	request := gpioV2LineRequest{
+		NumLines: 1,
+		Config:   gpioV2LineConfig{Flags: flags},
+	}
+	request.Offsets[0] = uint32(line)
+	copy(request.Consumer[:], []byte("sysfsGPIO"))
+
+	if err := ioctl(chipFile.Fd(), gpioV2GetLineIoctl, unsafe.Pointer(&request)); err != nil {
+		chipFile.Close()
+		return nil, err
+	}
+
+	// Non-blocking so that eventTimestamps can drain every queued event after an edge-triggered epoll wakeup: the
+	// read that finds nothing left returns EAGAIN instead of blocking forever waiting for the next event.
+	if err := unix.SetNonblock(int(request.Fd), true); err != nil {
+		unix.Close(int(request.Fd))
+		chipFile.Close()
+		return nil, err
+	}
+
+	pin := IOPin{
+		GPIONum:     line,
+		Direction:   directionString,
+		TriggerEdge: "none",
+		Enabled:     true,
+	}
+	pin.backend = &cdevBackend{chip: chipFile, lineFd: int(request.Fd), offset: uint32(line), flags: flags}
+
+	return &pin, nil
+}
+
+// CdevLineName reports the kernel's name for a line, mostly useful for diagnostics when looking up a line by
+// number on an unfamiliar chip.
+func CdevLineName(chip string, line int) (string, error) {
+	chipFile, err := os.OpenFile("/dev/"+chip, os.O_RDWR, 0660)
+	if err != nil {
+		return "", err
+	}
+	defer chipFile.Close()
+
+	info := gpioV2LineInfo{Offset: uint32(line)}
+	if err := ioctl(chipFile.Fd(), gpioV2LineInfoIoctl, unsafe.Pointer(&info)); err != nil {
+		return "", errors.New("sysfsGPIO: failed to get line info for " + chip + " line " + strconv.Itoa(line) + ": " + err.Error())
+	}
+
+	return nullTerminatedString(info.Name[:]), nil
+}
+
+// nullTerminatedString converts a fixed-size, NUL-terminated byte array straight out of a gpio_v2_line_info/request
+// struct into a Go string.
+func nullTerminatedString(b []byte) string {
+	n := 0
+	for n < len(b) && b[n] != 0 {
+		n++
+	}
+	return string(b[:n])
+}
+
+// NewCdevPinByName looks up line by the kernel-reported name on chip (e.g. "GPIO17") and requests it the same way
+// as NewCdevPin. This is useful on boards where a line's consumer-facing name is stable across revisions but its
+// numeric offset is not.
+func NewCdevPinByName(chip, name string, dir Direction) (*IOPin, error) {
+	chipFile, err := os.OpenFile("/dev/"+chip, os.O_RDWR, 0660)
+	if err != nil {
+		return nil, err
+	}
+	defer chipFile.Close()
+
+	for offset := 0; offset < gpioV2LinesMax; offset++ {
+		info := gpioV2LineInfo{Offset: uint32(offset)}
+		if err := ioctl(chipFile.Fd(), gpioV2LineInfoIoctl, unsafe.Pointer(&info)); err != nil {
+			break
+		}
+		if nullTerminatedString(info.Name[:]) == name {
+			return NewCdevPin(chip, offset, dir)
+		}
+	}
+
+	return nil, errors.New("sysfsGPIO: no line named " + name + " found on " + chip)
+}
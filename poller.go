@@ -0,0 +1,343 @@
+/*
+Copyright (c) 2018 Forrest Sibley <My^Name^Without^The^Surname@ieee.org>
+
+Permission is hereby granted, free of charge, to any person obtaining
+a copy of this software and associated documentation files (the
+"Software"), to deal in the Software without restriction, including
+without limitation the rights to use, copy, modify, merge, publish,
+distribute, sublicense, and/or sell copies of the Software, and to
+permit persons to whom the Software is furnished to do so, subject to
+the following conditions:
+
+The above copyright notice and this permission notice shall be
+included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package sysfsGPIO
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// These are defines for the Epoll system. At the time that this code was written, poll() and select() were not
+// implemented in golang, and epoll() is implemented but might not be fully implemented. syscall.EPOLLIN functions as
+// expected, but syscall.EPOLLET does not. The following 1 << 31 shift came from the single epoll() go example
+// that I was able to find; someone else apparently ran into similar problems. Upon further examination, the difference
+// is in the sign: syscall.EPOLLET is -2147483648 while the EPOLLET below is the absolute value of it, e.g. there
+// seems to be an issue with the signed math in the Go library.
+//
+// Someone else found this problem.
+// https://github.com/golang/go/issues/5328
+// The constant is apparently corrected elsewhere.
+// https://godoc.org/golang.org/x/sys/unix
+
+const (
+	EPOLLET = unix.EPOLLET
+	// EPOLLET = 1 << 31
+	// Maximum number of epoll events. This parameter is fed to the kernel.
+	MaxPollEvents = 32
+	// This is set to an arbitrarily high value and should be more than enough for an RPi Zero.
+	MaxIOPinCount = 128
+)
+
+// Poller owns a single epoll instance and the goroutine that services it, dispatching edge events to the Event
+// subscriptions of every IOPin that has been added to it, as well as to its own shared InterruptStream for
+// backwards compatibility with the old package-level GetInterruptStream. Unlike the epollData global this
+// replaces, a Poller is constructed explicitly (or lazily the first time a pin needs one) and can be shut down
+// with Halt or Close, so the package no longer leaks a goroutine that runs for the lifetime of the process - it
+// can be embedded in a larger program or driven from a test without stealing that program's SIGINT handling.
+type Poller struct {
+	epollFd int
+	// wakeFd is an eventfd registered with the epoll instance purely so that Halt/Close can interrupt a blocked
+	// EpollWait and let the loop goroutine exit.
+	wakeFd int
+
+	mu   sync.Mutex
+	pins map[int32]*IOPin
+
+	interruptStream chan InterruptData
+
+	closeOnce sync.Once
+	stopped   chan struct{}
+
+	releaseOnce sync.Once
+	releaseErr  error
+}
+
+// NewPoller creates an epoll instance and starts the goroutine that services it. Callers are responsible for
+// calling Close when they are done with the Poller.
+func NewPoller() (*Poller, error) {
+	epollFd, err := unix.EpollCreate1(0)
+	if err != nil {
+		return nil, err
+	}
+
+	wakeFd, err := unix.Eventfd(0, unix.EFD_NONBLOCK)
+	if err != nil {
+		unix.Close(epollFd)
+		return nil, err
+	}
+
+	wakeEvent := unix.EpollEvent{Events: unix.EPOLLIN, Fd: int32(wakeFd)}
+	if err := unix.EpollCtl(epollFd, unix.EPOLL_CTL_ADD, wakeFd, &wakeEvent); err != nil {
+		unix.Close(wakeFd)
+		unix.Close(epollFd)
+		return nil, err
+	}
+
+	p := &Poller{
+		epollFd:         epollFd,
+		wakeFd:          wakeFd,
+		pins:            make(map[int32]*IOPin, MaxIOPinCount),
+		interruptStream: make(chan InterruptData, MaxPollEvents),
+		stopped:         make(chan struct{}),
+	}
+
+	go p.loop()
+
+	return p, nil
+}
+
+// Add registers pin with the poller so its edge events are delivered over InterruptStream and pin.Subscribe. A pin
+// whose backend has no real file descriptor (a sysfs pin running against a non-OS Backend, e.g. MemBackend) is
+// tracked for InjectEdge but is not handed to epoll, since there is nothing there for the kernel to watch.
+func (p *Poller) Add(pin *IOPin) error {
+	fd := pin.backend.fd()
+
+	if fd >= 0 {
+		event := unix.EpollEvent{Events: unix.EPOLLIN | EPOLLET, Fd: int32(fd)}
+		if err := unix.EpollCtl(p.epollFd, unix.EPOLL_CTL_ADD, fd, &event); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	p.pins[int32(fd)] = pin
+	p.mu.Unlock()
+
+	return nil
+}
+
+// Remove stops delivering events for pin. It is safe to call on a pin that was never added.
+func (p *Poller) Remove(pin *IOPin) error {
+	fd := pin.backend.fd()
+
+	p.mu.Lock()
+	_, known := p.pins[int32(fd)]
+	delete(p.pins, int32(fd))
+	p.mu.Unlock()
+
+	// A pin that was never added (or already removed) has nothing registered with epoll to delete; doing so
+	// anyway would return ENOENT, contradicting the "safe to call" contract above.
+	if fd < 0 || !known {
+		return nil
+	}
+
+	if err := unix.EpollCtl(p.epollFd, unix.EPOLL_CTL_DEL, fd, &unix.EpollEvent{}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// InjectEdge synthesizes an edge event for pin and runs it through the same debounce/subscribe/publish path as a
+// real one, without going through epoll. It is meant for tests of pins backed by a MemBackend, whose fd is
+// synthetic and so can never actually become readable.
+func (p *Poller) InjectEdge(pin *IOPin) {
+	p.dispatch(pin)
+}
+
+// InterruptStream returns this poller's shared stream of every added pin's events. Prefer IOPin.Subscribe for new
+// code.
+func (p *Poller) InterruptStream() <-chan InterruptData {
+	return p.interruptStream
+}
+
+// Halt stops the poller's goroutine without releasing the epoll and wakeup file descriptors, and blocks until it
+// has exited. It is idempotent, and a halted Poller cannot be restarted - construct a new one instead.
+func (p *Poller) Halt() {
+	p.closeOnce.Do(func() {
+		var one uint64 = 1
+		unix.Write(p.wakeFd, (*[8]byte)(unsafe.Pointer(&one))[:])
+	})
+	<-p.stopped
+}
+
+// Close halts the poller and releases its epoll and wakeup file descriptors. It is idempotent.
+func (p *Poller) Close() error {
+	p.Halt()
+
+	p.releaseOnce.Do(func() {
+		if err := unix.Close(p.wakeFd); err != nil {
+			p.releaseErr = err
+			return
+		}
+		p.releaseErr = unix.Close(p.epollFd)
+	})
+	return p.releaseErr
+}
+
+func (p *Poller) loop() {
+	defer close(p.stopped)
+
+	var events [MaxPollEvents]unix.EpollEvent
+	for {
+		numEvents, err := unix.EpollWait(p.epollFd, events[:], -1)
+		if err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			fmt.Println("epoll_wait error ", err)
+			continue
+		}
+
+		for ev := 0; ev < numEvents; ev++ {
+			fd := events[ev].Fd
+
+			if fd == int32(p.wakeFd) {
+				return
+			}
+
+			p.mu.Lock()
+			ioPin := p.pins[fd]
+			p.mu.Unlock()
+
+			if ioPin != nil {
+				p.dispatch(ioPin)
+			}
+		}
+	}
+}
+
+// dispatch drains every edge event that is currently available for ioPin and delivers one Event/InterruptData per
+// event actually read. This is necessary because the line fd is registered edge-triggered (EPOLLET): if the kernel
+// had already queued more than one gpio_v2_line_event by the time EpollWait woke us, reading only the first would
+// silently drop the rest, since ET semantics do not guarantee a further wakeup for events that were already pending.
+func (p *Poller) dispatch(ioPin *IOPin) {
+	timestamps, err := ioPin.backend.eventTimestamps()
+	if err != nil || len(timestamps) == 0 {
+		timestamps = []time.Time{time.Now()}
+	}
+
+	for _, timestamp := range timestamps {
+		p.dispatchOne(ioPin, timestamp)
+	}
+}
+
+// dispatchOne applies debouncing, builds the event for a single edge trigger, and delivers it both to the shared
+// InterruptStream and to the pin's own subscribers.
+func (p *Poller) dispatchOne(ioPin *IOPin, timestamp time.Time) {
+	// Drop the event if it falls within the debounce window of the previous accepted event for this pin.
+	// SetDebounce defaults to zero, which disables this check entirely.
+	now := time.Now()
+	if ioPin.debounce > 0 && !ioPin.lastEventTime.IsZero() && now.Sub(ioPin.lastEventTime) < ioPin.debounce {
+		return
+	}
+	ioPin.lastEventTime = now
+
+	// Note: There is a possibility that this value can be wrong if the pin has been modified by another
+	// process. It is much faster to use the edge value already in this program's memory than to go back to
+	// SysFS and poll another file.
+	edge := ioPin.TriggerEdge
+	var stateString string
+	var stateInt int
+
+	if edge == "rising" {
+		stateString = "high"
+		stateInt = 1
+	} else if edge == "falling" {
+		stateString = "low"
+		stateInt = 0
+	} else if edge == "both" {
+		stateInt, _ = ioPin.Read()
+		if stateInt == 0 {
+			stateString = "low"
+		} else if stateInt == 1 {
+			stateString = "high"
+		}
+	}
+
+	// Do not allow the channel to overflow
+	if len(p.interruptStream) != cap(p.interruptStream) {
+		p.interruptStream <- InterruptData{ioPin, edge, stateString, stateInt}
+	}
+
+	ioPin.subMu.Lock()
+	ioPin.seq++
+	seq := ioPin.seq
+	ioPin.subMu.Unlock()
+
+	ioPin.publish(Event{
+		IOPin:       ioPin,
+		Edge:        edge,
+		StateString: stateString,
+		StateInt:    stateInt,
+		Timestamp:   timestamp,
+		Seq:         seq,
+	})
+}
+
+// The package-level pin methods (AddPinInterrupt, DeletePinInterrupt, GetInterruptStream) are kept for backwards
+// compatibility and run against a single, lazily-constructed default Poller.
+var (
+	defaultPollerOnce sync.Once
+	defaultPollerInst *Poller
+	defaultPollerErr  error
+)
+
+func defaultPoller() (*Poller, error) {
+	defaultPollerOnce.Do(func() {
+		defaultPollerInst, defaultPollerErr = NewPoller()
+	})
+	return defaultPollerInst, defaultPollerErr
+}
+
+// InstallSignalHandler registers a SIGINT handler that releases every pin known to the default Poller before
+// exiting the process. Earlier versions of this package installed this unconditionally from init(), which made it
+// impossible to embed the package in a program that wanted to handle SIGINT itself (or to run it under `go test`
+// without the test binary being killed). Call this explicitly if you want that behavior back.
+func InstallSignalHandler() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		for sig := range c {
+			fmt.Println("Interrupt signal received:", sig)
+
+			p, err := defaultPoller()
+			if err == nil {
+				p.mu.Lock()
+				pins := make([]*IOPin, 0, len(p.pins))
+				for _, pin := range p.pins {
+					pins = append(pins, pin)
+				}
+				p.mu.Unlock()
+
+				for _, pin := range pins {
+					pin.Enabled = false
+					if err := pin.ReleasePin(); err != nil {
+						fmt.Println("Error releasing pin upon program exit:", err)
+					}
+				}
+			}
+
+			fmt.Println("Pins have been released in SysFS.")
+
+			os.Exit(1)
+		}
+	}()
+}
@@ -0,0 +1,240 @@
+/*
+Copyright (c) 2018 Forrest Sibley <My^Name^Without^The^Surname@ieee.org>
+
+Permission is hereby granted, free of charge, to any person obtaining
+a copy of this software and associated documentation files (the
+"Software"), to deal in the Software without restriction, including
+without limitation the rights to use, copy, modify, merge, publish,
+distribute, sublicense, and/or sell copies of the Software, and to
+permit persons to whom the Software is furnished to do so, subject to
+the following conditions:
+
+The above copyright notice and this permission notice shall be
+included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package sysfsGPIO
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PWM is the common interface shared by PWMPin (hardware /sys/class/pwm) and SoftPWMPin (software, bit-banged on
+// an IOPin). Prefer NewPWM, which picks whichever of the two is appropriate for the requested chip/channel.
+type PWM interface {
+	// SetFrequency sets the PWM frequency in Hz. It may be called while the PWM is running.
+	SetFrequency(hz float64) error
+	// SetDutyCycle sets the fraction of each period spent high, as a percentage in [0, 100].
+	SetDutyCycle(duty float64) error
+	Start() error
+	Stop() error
+}
+
+// NewPWM returns a hardware PWMPin for chip/channel if /sys/class/pwm/pwmchipN exists, or falls back to a
+// software SoftPWMPin driven by fallbackPin if it does not. Pass a nil fallbackPin to require hardware PWM.
+func NewPWM(chip, channel int, fallbackPin *IOPin) (PWM, error) {
+	if _, err := os.Stat(pwmChipPath(chip)); err == nil {
+		return InitPWMPin(chip, channel)
+	}
+
+	if fallbackPin == nil {
+		return nil, errors.New("sysfsGPIO: " + pwmChipPath(chip) + " does not exist and no fallback pin was provided for software PWM")
+	}
+	return NewSoftPWM(fallbackPin), nil
+}
+
+func pwmChipPath(chip int) string {
+	return "/sys/class/pwm/pwmchip" + strconv.Itoa(chip)
+}
+
+// PWMPin drives a hardware PWM channel via /sys/class/pwm/pwmchipN/pwmM.
+type PWMPin struct {
+	chip    int
+	channel int
+
+	// periodNs is cached so that SetDutyCycle can convert its percentage into the duty_cycle attribute, which the
+	// kernel wants in nanoseconds.
+	periodNs uint64
+}
+
+func (p *PWMPin) path(attribute string) string {
+	return pwmChipPath(p.chip) + "/pwm" + strconv.Itoa(p.channel) + "/" + attribute
+}
+
+// InitPWMPin exports pwmchipN's channel M, if it is not already exported, and returns a PWMPin for it. Call
+// SetFrequency and SetDutyCycle before Start.
+func InitPWMPin(chip, channel int) (*PWMPin, error) {
+	pin := &PWMPin{chip: chip, channel: channel}
+
+	if _, err := os.Stat(pin.path("")); os.IsNotExist(err) {
+		err := ioutil.WriteFile(pwmChipPath(chip)+"/export", []byte(strconv.Itoa(channel)), os.ModeDevice|os.ModeCharDevice)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return pin, nil
+}
+
+// SetFrequency sets the PWM period to 1/hz seconds.
+func (p *PWMPin) SetFrequency(hz float64) error {
+	if hz <= 0 {
+		return errors.New("sysfsGPIO: PWM frequency must be positive")
+	}
+
+	p.periodNs = uint64(1e9 / hz)
+	return ioutil.WriteFile(p.path("period"), []byte(strconv.FormatUint(p.periodNs, 10)), os.ModeDevice|os.ModeCharDevice)
+}
+
+// SetDutyCycle sets the fraction of each period spent high, as a percentage in [0, 100]. SetFrequency must be
+// called first so the percentage can be converted to the nanosecond duration the kernel expects.
+func (p *PWMPin) SetDutyCycle(duty float64) error {
+	if duty < 0 || duty > 100 {
+		return errors.New("sysfsGPIO: PWM duty cycle must be between 0 and 100")
+	}
+	if p.periodNs == 0 {
+		return errors.New("sysfsGPIO: SetFrequency must be called before SetDutyCycle")
+	}
+
+	dutyNs := uint64(duty / 100 * float64(p.periodNs))
+	return ioutil.WriteFile(p.path("duty_cycle"), []byte(strconv.FormatUint(dutyNs, 10)), os.ModeDevice|os.ModeCharDevice)
+}
+
+// Start enables the PWM output.
+func (p *PWMPin) Start() error {
+	return ioutil.WriteFile(p.path("enable"), []byte("1"), os.ModeDevice|os.ModeCharDevice)
+}
+
+// Stop disables the PWM output.
+func (p *PWMPin) Stop() error {
+	return ioutil.WriteFile(p.path("enable"), []byte("0"), os.ModeDevice|os.ModeCharDevice)
+}
+
+// ReleasePWMPin stops the channel and un-exports it.
+func (p *PWMPin) ReleasePWMPin() error {
+	if err := p.Stop(); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(pwmChipPath(p.chip)+"/unexport", []byte(strconv.Itoa(p.channel)), os.ModeDevice|os.ModeCharDevice)
+}
+
+// SoftPWMPin bit-bangs a PWM signal on an ordinary output IOPin using a dedicated goroutine and time.After timers.
+// Accuracy is limited by Go's goroutine scheduling and GC pauses - expect visible jitter above a few hundred Hz,
+// and prefer PWMPin (or NewPWM, which picks it automatically) whenever the target has real hardware PWM.
+type SoftPWMPin struct {
+	pin *IOPin
+
+	mu        sync.Mutex
+	frequency float64
+	duty      float64
+	running   bool
+	stopCh    chan struct{}
+}
+
+// NewSoftPWM returns a SoftPWMPin driving pin. Call SetFrequency and SetDutyCycle before Start.
+func NewSoftPWM(pin *IOPin) *SoftPWMPin {
+	return &SoftPWMPin{pin: pin, frequency: 100}
+}
+
+// SetFrequency sets the PWM frequency in Hz. It may be called while running; the new frequency takes effect at
+// the start of the next period.
+func (s *SoftPWMPin) SetFrequency(hz float64) error {
+	if hz <= 0 {
+		return errors.New("sysfsGPIO: PWM frequency must be positive")
+	}
+
+	s.mu.Lock()
+	s.frequency = hz
+	s.mu.Unlock()
+	return nil
+}
+
+// SetDutyCycle sets the fraction of each period spent high, as a percentage in [0, 100]. It may be called while
+// running; the new duty cycle takes effect at the start of the next period.
+func (s *SoftPWMPin) SetDutyCycle(duty float64) error {
+	if duty < 0 || duty > 100 {
+		return errors.New("sysfsGPIO: PWM duty cycle must be between 0 and 100")
+	}
+
+	s.mu.Lock()
+	s.duty = duty
+	s.mu.Unlock()
+	return nil
+}
+
+// Start launches the bit-banging goroutine. It is a no-op if already running.
+func (s *SoftPWMPin) Start() error {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return nil
+	}
+	s.running = true
+	s.stopCh = make(chan struct{})
+	stopCh := s.stopCh
+	s.mu.Unlock()
+
+	go s.run(stopCh)
+
+	return nil
+}
+
+// Stop halts the bit-banging goroutine and drives the pin low. It is a no-op if not running.
+func (s *SoftPWMPin) Stop() error {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return nil
+	}
+	s.running = false
+	close(s.stopCh)
+	s.mu.Unlock()
+
+	return s.pin.SetLow()
+}
+
+// run alternates the pin between high and low, re-reading the frequency and duty cycle at the start of every
+// cycle. The high and low phases are timed against their own explicit durations (onTime, then period-onTime)
+// rather than a single ticker reset after the high phase has already elapsed, which would make the real cycle
+// length period+onTime instead of period.
+func (s *SoftPWMPin) run(stopCh chan struct{}) {
+	for {
+		s.mu.Lock()
+		period := time.Duration(float64(time.Second) / s.frequency)
+		onTime := time.Duration(s.duty / 100 * float64(period))
+		s.mu.Unlock()
+
+		if onTime > 0 {
+			s.pin.SetHigh()
+			select {
+			case <-stopCh:
+				s.pin.SetLow()
+				return
+			case <-time.After(onTime):
+			}
+		}
+
+		s.pin.SetLow()
+
+		if lowTime := period - onTime; lowTime > 0 {
+			select {
+			case <-stopCh:
+				return
+			case <-time.After(lowTime):
+			}
+		}
+	}
+}
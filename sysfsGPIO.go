@@ -25,45 +25,61 @@ package sysfsGPIO
 
 import (
 	"errors"
-	"fmt"
-	"io/ioutil"
 	"os"
-	"os/signal"
 	"strconv"
-	"syscall"
+	"sync"
+	"time"
+)
+
+// Direction describes whether a pin is used for input or output. It is used by the character-device backend; the
+// legacy sysfs-based InitPin still takes the historical "in"/"out" strings so that existing callers keep working.
+type Direction int
+
+const (
+	DirectionInput Direction = iota
+	DirectionOutput
+)
 
-	"golang.org/x/sys/unix"
+// Bias selects a line's input bias: whether its internal pull-up or pull-down resistor is enabled.
+type Bias int
+
+const (
+	BiasDisabled Bias = iota
+	BiasPullUp
+	BiasPullDown
 )
 
-// These are defines for the Epoll system. At the time that this code was written, poll() and select() were not
-// implemented in golang, and epoll() is implemented but might not be fully implemented. syscall.EPOLLIN functions as
-// expected, but syscall.EPOLLET does not. The following 1 << 31 shift came from the single epoll() go example
-// that I was able to find; someone else apparently ran into similar problems. Upon further examination, the difference
-// is in the sign: syscall.EPOLLET is -2147483648 while the EPOLLET below is the absolute value of it, e.g. there
-// seems to be an issue with the signed math in the Go library.
-//
-// Someone else found this problem.
-// https://github.com/golang/go/issues/5328
-// The constant is apparently corrected elsewhere.
-// https://godoc.org/golang.org/x/sys/unix
+// Drive selects an output line's drive mode.
+type Drive int
 
 const (
-	EPOLLET = unix.EPOLLET
-	// EPOLLET = 1 << 31
-	// Maximum number of epoll events. This parameter is fed to the kernel.
-	MaxPollEvents = 32
-	// This is set to an arbitrarily high value and should be more than enough for an RPi Zero.
-	MaxIOPinCount = 128
+	DrivePushPull Drive = iota
+	DriveOpenDrain
+	DriveOpenSource
 )
 
-// Epoll data struct. This struct should be created only once per process and should contain all of the information
-// needed for the Epoll call.
-var epollData struct {
-	// Epoll file descriptor
-	fd int
-	// Single Epoll event and an array corresponding to all the events that the OS will describe after returning
-	event  syscall.EpollEvent
-	events [MaxPollEvents]syscall.EpollEvent
+// pinBackend abstracts the transport used to talk to a single GPIO line. sysfsBackend implements it on top of the
+// deprecated /sys/class/gpio interface, and cdevBackend implements it on top of the /dev/gpiochipN character device.
+// IOPin delegates all of its I/O to whichever backend it was constructed with, so the rest of the package -
+// including the epoll-based interrupt plumbing - does not need to know which transport is underneath.
+type pinBackend interface {
+	setHigh() error
+	setLow() error
+	read() (int, error)
+	setTriggerEdge(edge string) error
+	setActiveLow(activeLow bool) error
+	setBias(bias Bias) error
+	setDrive(drive Drive) error
+	// eventTimestamps drains every edge event currently available for this pin and returns one timestamp per
+	// event, in the order they occurred, so that a Poller can dispatch one Event/InterruptData per event actually
+	// read instead of losing everything past the first. The sysfs backend has no kernel event queue to drain and
+	// always returns a single time.Now(); the cdev backend reads gpio_v2_line_events off the line fd until it
+	// would block, returning their kernel-provided timestamp_ns values.
+	eventTimestamps() ([]time.Time, error)
+	fd() int
+	// release undoes whatever setHigh/setLow/... for this line acquired: the sysfs backend writes the pin back to
+	// "in" and un-exports it, and the cdev backend closes its line request fd and its chip file.
+	release() error
 }
 
 // A single RPi GPIO pin
@@ -76,15 +92,211 @@ type IOPin struct {
 	// Edge to trigger on
 	// Valid values are "rising" or "falling"
 	TriggerEdge string
-	// Sysfs file
+	// Sysfs file. Populated for pins created with InitPin against the real filesystem; left nil for pins created
+	// with NewCdevPin, or created with InitPin while a non-default Backend (e.g. MemBackend) is installed.
 	SysfsFile *os.File
 	// Enabled flag for internal use. This inhibits read or write operations to pins.
 	Enabled bool
+
+	// backend performs the actual I/O for this pin, selected at construction time by InitPin or NewCdevPin.
+	backend pinBackend
+
+	// debounce is the minimum spacing enforced between consecutive interrupt events for this pin. Zero disables
+	// debouncing. It is applied in software in Poller.dispatch, since plain /sys/class/gpio has no debounce of
+	// its own.
+	debounce time.Duration
+	// lastEventTime is the timestamp of the last interrupt event that was not dropped for debounce. It is written
+	// without a lock by Poller.dispatchOne, which runs on the Poller's goroutine or on the caller of
+	// Poller.InjectEdge.
+	lastEventTime time.Time
+
+	// subMu guards seq and subs, which are written from a Poller's goroutine and read/written from Subscribe and
+	// the unsubscribe funcs it returns.
+	subMu sync.Mutex
+	// seq counts every event dispatched for this pin, including ones dropped by a lossy subscription. Consumers
+	// can compare Event.Seq between receives to detect whether they fell behind.
+	seq  uint64
+	subs []*subscription
+}
+
+// Event is a single edge event for one pin, delivered via the channel returned by IOPin.Subscribe.
+type Event struct {
+	IOPin       *IOPin
+	Edge        string
+	StateString string
+	StateInt    int
+	// Timestamp is captured by the Poller: time.Now() for sysfs pins, or the kernel-provided CLOCK_MONOTONIC
+	// timestamp_ns for cdev pins.
+	Timestamp time.Time
+	// Seq is this pin's event counter at the time this event was dispatched. A gap between the Seq of two
+	// consecutively received events means one or more events were dropped by a lossy subscription.
+	Seq uint64
+}
+
+// subscriptionMode selects what a subscription does when its channel buffer is full.
+type subscriptionMode int
+
+const (
+	// lossy drops the new event and keeps the ISR goroutine non-blocking. This is the default, and matches the
+	// overflow behavior of the package-wide GetInterruptStream channel.
+	lossy subscriptionMode = iota
+	// lossless blocks the ISR goroutine until the subscriber drains its channel. This guarantees delivery, but a
+	// slow or stuck subscriber stalls event delivery to every other pin.
+	lossless
+)
+
+type subscription struct {
+	ch   chan Event
+	mode subscriptionMode
+}
+
+// SubscribeOption configures a subscription created by IOPin.Subscribe.
+type SubscribeOption func(*subscription)
+
+// WithLossless makes a subscription lossless: the ISR goroutine blocks on a full channel instead of dropping the
+// event. Only use this when the subscriber is guaranteed to keep up, since a stuck subscriber will stall delivery
+// to every other subscriber and pin.
+func WithLossless() SubscribeOption {
+	return func(s *subscription) {
+		s.mode = lossless
+	}
+}
+
+// Subscribe returns a channel of this pin's edge events and an unsubscribe function. By default the subscription
+// is lossy: if the channel's buffer fills because the consumer isn't keeping up, new events are dropped rather
+// than blocking the Poller's goroutine; compare Event.Seq across receives to detect this. Pass WithLossless to
+// block instead of dropping. The unsubscribe function closes the channel and must be called to release it.
+func (pin *IOPin) Subscribe(opts ...SubscribeOption) (<-chan Event, func()) {
+	sub := &subscription{ch: make(chan Event, MaxPollEvents)}
+	for _, opt := range opts {
+		opt(sub)
+	}
+
+	pin.subMu.Lock()
+	pin.subs = append(pin.subs, sub)
+	pin.subMu.Unlock()
+
+	unsubscribe := func() {
+		pin.subMu.Lock()
+		for i, s := range pin.subs {
+			if s == sub {
+				pin.subs = append(pin.subs[:i], pin.subs[i+1:]...)
+				break
+			}
+		}
+		pin.subMu.Unlock()
+		close(sub.ch)
+	}
+
+	return sub.ch, unsubscribe
+}
+
+// publish delivers ev to every current subscriber of this pin, honoring each subscription's lossy/lossless mode.
+// Called from a Poller's goroutine.
+func (pin *IOPin) publish(ev Event) {
+	pin.subMu.Lock()
+	defer pin.subMu.Unlock()
+
+	for _, sub := range pin.subs {
+		if sub.mode == lossless {
+			sub.ch <- ev
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+		}
+	}
+}
+
+// sysfsBackend implements pinBackend on top of /sys/class/gpio/gpioN. All of its filesystem access goes through
+// the package-level backend variable, so InitPin can be pointed at a MemBackend in tests.
+type sysfsBackend struct {
+	gpioNum int
+	file    pinFile
+}
+
+func (b *sysfsBackend) setHigh() error {
+	_, err := b.file.Write([]byte("1"))
+	return err
+}
+
+func (b *sysfsBackend) setLow() error {
+	_, err := b.file.Write([]byte("0"))
+	return err
+}
+
+func (b *sysfsBackend) read() (int, error) {
+	readBuffer := make([]byte, 1)
+	// Must rewind for every read
+	b.file.Seek(0, 0)
+	_, err := b.file.Read(readBuffer)
+	if err != nil {
+		return -1, err
+	}
+	return int(readBuffer[0] & 1), nil
+}
+
+func (b *sysfsBackend) setTriggerEdge(edge string) error {
+	edgeFileName := "/sys/class/gpio/gpio" + strconv.Itoa(b.gpioNum) + "/edge"
+	return backend.WriteFile(edgeFileName, []byte(edge), os.ModeDevice|os.ModeCharDevice)
+}
+
+// setActiveLow writes to gpioN/active_low, which the kernel sysfs driver has supported since it was introduced.
+func (b *sysfsBackend) setActiveLow(activeLow bool) error {
+	activeLowFileName := "/sys/class/gpio/gpio" + strconv.Itoa(b.gpioNum) + "/active_low"
+	value := "0"
+	if activeLow {
+		value = "1"
+	}
+	return backend.WriteFile(activeLowFileName, []byte(value), os.ModeDevice|os.ModeCharDevice)
+}
+
+// setBias is not supported: plain /sys/class/gpio has no attribute for internal pull resistors. Use NewCdevPin if
+// bias configuration is required.
+func (b *sysfsBackend) setBias(bias Bias) error {
+	return errors.New("sysfsGPIO: bias configuration is not supported by the sysfs backend; use NewCdevPin")
+}
+
+// setDrive is not supported: plain /sys/class/gpio has no attribute for open-drain/open-source output drive. Use
+// NewCdevPin if drive configuration is required.
+func (b *sysfsBackend) setDrive(drive Drive) error {
+	return errors.New("sysfsGPIO: drive configuration is not supported by the sysfs backend; use NewCdevPin")
+}
+
+// eventTimestamps has no kernel event queue or timestamp to draw on under plain sysfs: every epoll wakeup is
+// always exactly one event, observed at the current time.
+func (b *sysfsBackend) eventTimestamps() ([]time.Time, error) {
+	return []time.Time{time.Now()}, nil
 }
 
-// A map of file descriptors to *IOPin. This is needed to back-reference the file descriptor returned by the kernel to
-// an IOPin struct.
-var fileDescriptorMap map[int32]*IOPin
+// fd reports the real file descriptor behind b.file, or its synthetic FakeFD when running against a Backend (e.g.
+// MemBackend) that does not open real files - a Poller treats the latter as unrepresentable in epoll and skips
+// registering it, while still tracking the pin for InjectEdge.
+func (b *sysfsBackend) fd() int {
+	if f, ok := b.file.(interface{ Fd() uintptr }); ok {
+		return int(f.Fd())
+	}
+	if f, ok := b.file.(interface{ FakeFD() int }); ok {
+		return f.FakeFD()
+	}
+	return -1
+}
+
+// release writes the pin back to input, closes its value file, and un-exports it in sysfs.
+func (b *sysfsBackend) release() error {
+	directionFileName := "/sys/class/gpio/gpio" + strconv.Itoa(b.gpioNum) + "/direction"
+	if err := backend.WriteFile(directionFileName, []byte("in"), os.ModeDevice|os.ModeCharDevice); err != nil {
+		return err
+	}
+
+	if err := b.file.Close(); err != nil {
+		return err
+	}
+
+	sysfsPinNumber := []byte(strconv.Itoa(b.gpioNum))
+	return backend.WriteFile("/sys/class/gpio/unexport", sysfsPinNumber, os.ModeDevice|os.ModeCharDevice)
+}
 
 // Initialize a GPIO pin
 func InitPin(gpioNum int, direction string) (*IOPin, error) {
@@ -96,7 +308,7 @@ func InitPin(gpioNum int, direction string) (*IOPin, error) {
 	}
 	// Check to see whether the pin has already been exported
 	exportedCheckPath := "/sys/class/gpio/gpio" + strconv.Itoa(pin.GPIONum)
-	_, err := os.Stat(exportedCheckPath)
+	_, err := backend.Stat(exportedCheckPath)
 
 	// If the file corresponding to the exported pin does not exist, create it
 	if os.IsNotExist(err) {
@@ -104,7 +316,7 @@ func InitPin(gpioNum int, direction string) (*IOPin, error) {
 		// ioutil file writer to sysfs format
 		sysfsPinNumber := []byte(strconv.Itoa(pin.GPIONum))
 		// Export the pin
-		err := ioutil.WriteFile("/sys/class/gpio/export", sysfsPinNumber, os.ModeDevice|os.ModeCharDevice)
+		err := backend.WriteFile("/sys/class/gpio/export", sysfsPinNumber, os.ModeDevice|os.ModeCharDevice)
 		if err != nil {
 			return nil, err
 		}
@@ -113,7 +325,7 @@ func InitPin(gpioNum int, direction string) (*IOPin, error) {
 	// Set the direction: "in" (input) or "out" (output)
 	directionFileName := "/sys/class/gpio/gpio" + strconv.Itoa(pin.GPIONum) + "/direction"
 	sysfsPinDirection := []byte(pin.Direction)
-	err = ioutil.WriteFile(directionFileName, sysfsPinDirection, os.ModeDevice|os.ModeCharDevice)
+	err = backend.WriteFile(directionFileName, sysfsPinDirection, os.ModeDevice|os.ModeCharDevice)
 	if err != nil {
 		return nil, err
 	}
@@ -124,7 +336,7 @@ func InitPin(gpioNum int, direction string) (*IOPin, error) {
 	if pin.Direction == "in" && len(pin.TriggerEdge) != 0 {
 		edgeFileName := "/sys/class/gpio/gpio" + strconv.Itoa(pin.GPIONum) + "/edge"
 		sysfsPinEdge := []byte(pin.TriggerEdge)
-		err = ioutil.WriteFile(edgeFileName, sysfsPinEdge, os.ModeDevice|os.ModeCharDevice)
+		err = backend.WriteFile(edgeFileName, sysfsPinEdge, os.ModeDevice|os.ModeCharDevice)
 		if err != nil {
 			return nil, err
 		}
@@ -132,17 +344,23 @@ func InitPin(gpioNum int, direction string) (*IOPin, error) {
 
 	// Open and leave open the device file for reading or writing digital data
 	valueFileName := "/sys/class/gpio/gpio" + strconv.Itoa(pin.GPIONum) + "/value"
+	var file pinFile
 	if pin.Direction == "out" {
-		pin.SysfsFile, err = os.OpenFile(valueFileName, os.O_RDWR, 0660)
+		file, err = backend.OpenFile(valueFileName, os.O_RDWR, 0660)
 	} else {
-		pin.SysfsFile, err = os.OpenFile(valueFileName, os.O_RDONLY, 0660)
+		file, err = backend.OpenFile(valueFileName, os.O_RDONLY, 0660)
 	}
 	if err != nil {
 		return nil, err
 	}
 
-	// Create a mapping from file descriptor to *IOPin
-	fileDescriptorMap[int32(pin.SysfsFile.Fd())] = &pin
+	// SysfsFile is only populated when the open file is a real *os.File - i.e. when running against the default,
+	// real-filesystem Backend.
+	if osFile, ok := file.(*os.File); ok {
+		pin.SysfsFile = osFile
+	}
+
+	pin.backend = &sysfsBackend{gpioNum: pin.GPIONum, file: file}
 
 	return &pin, nil
 }
@@ -156,57 +374,98 @@ func (pin *IOPin) SetTriggerEdge(triggerEdge string) error {
 		return errors.New("Error: Invalid trigger edge specified")
 	}
 
-	// Write to SysFS file
-	edgeFileName := "/sys/class/gpio/gpio" + strconv.Itoa(pin.GPIONum) + "/edge"
-	sysfsPinEdge := []byte(pin.TriggerEdge)
-	err := ioutil.WriteFile(edgeFileName, sysfsPinEdge, os.ModeDevice|os.ModeCharDevice)
-	if err != nil {
-		return err
-	}
+	return pin.backend.setTriggerEdge(pin.TriggerEdge)
+}
 
-	return nil
+// SetActiveLow inverts the logical sense of the pin: when active, a logical "1" is reported/driven as an
+// electrical low, and vice versa.
+func (pin *IOPin) SetActiveLow(activeLow bool) error {
+	return pin.backend.setActiveLow(activeLow)
 }
 
-// Release the GPIO pin and close sysfs files
-func (pin *IOPin) ReleasePin() error {
-	// Set the pin to be an input. This operation is likely overkill on some systems and is put here as added
-	// protection that the pin will not be in output state when it is un-exported in SysFS.
-	pin.Direction = "in"
-	pin.Enabled = false
-	directionFileName := "/sys/class/gpio/gpio" + strconv.Itoa(pin.GPIONum) + "/direction"
-	sysfsPinDirection := []byte(pin.Direction)
-	err := ioutil.WriteFile(directionFileName, sysfsPinDirection, os.ModeDevice|os.ModeCharDevice)
-	if err != nil {
-		return err
+// SetBias configures the pin's internal pull-up/pull-down resistor. Only supported on pins created with
+// NewCdevPin; sysfs pins return an error.
+func (pin *IOPin) SetBias(bias Bias) error {
+	return pin.backend.setBias(bias)
+}
+
+// SetDrive configures an output pin's drive mode (push-pull, open-drain, or open-source). Only supported on pins
+// created with NewCdevPin; sysfs pins return an error.
+func (pin *IOPin) SetDrive(drive Drive) error {
+	return pin.backend.setDrive(drive)
+}
+
+// SetDebounce sets the minimum spacing enforced between consecutive interrupt events delivered for this pin.
+// Events arriving less than d after the last accepted one are dropped in the ISR goroutine. A zero duration
+// (the default) disables debouncing.
+func (pin *IOPin) SetDebounce(d time.Duration) {
+	pin.debounce = d
+}
+
+// PinOption configures a pin as part of InitPinWithOptions.
+type PinOption func(pin *IOPin) error
+
+// WithActiveLow returns a PinOption that calls SetActiveLow.
+func WithActiveLow(activeLow bool) PinOption {
+	return func(pin *IOPin) error {
+		return pin.SetActiveLow(activeLow)
+	}
+}
+
+// WithBias returns a PinOption that calls SetBias.
+func WithBias(bias Bias) PinOption {
+	return func(pin *IOPin) error {
+		return pin.SetBias(bias)
 	}
+}
 
-	// Close the device file
-	err = pin.SysfsFile.Close()
-	if err != nil {
-		return err
+// WithDrive returns a PinOption that calls SetDrive.
+func WithDrive(drive Drive) PinOption {
+	return func(pin *IOPin) error {
+		return pin.SetDrive(drive)
 	}
+}
 
-	// Un-export the pin in Sysfs
+// WithDebounce returns a PinOption that calls SetDebounce.
+func WithDebounce(d time.Duration) PinOption {
+	return func(pin *IOPin) error {
+		pin.SetDebounce(d)
+		return nil
+	}
+}
 
-	// Convert the pin number to something that can be written by ioutil
-	// file writer to sysfs
-	sysfsPinNumber := []byte(strconv.Itoa(pin.GPIONum))
-	// Unxport the pin
-	err = ioutil.WriteFile("/sys/class/gpio/unexport", sysfsPinNumber, os.ModeDevice|os.ModeCharDevice)
+// InitPinWithOptions is a functional-options variant of InitPin, applying each PinOption in order after the pin
+// has been exported and opened. If any option fails, the pin is released before the error is returned.
+func InitPinWithOptions(gpioNum int, direction string, opts ...PinOption) (*IOPin, error) {
+	pin, err := InitPin(gpioNum, direction)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	for _, opt := range opts {
+		if err := opt(pin); err != nil {
+			pin.ReleasePin()
+			return nil, err
+		}
+	}
+
+	return pin, nil
+}
+
+// Release the GPIO pin and close the underlying backend
+func (pin *IOPin) ReleasePin() error {
+	// Set the pin to be an input. This operation is likely overkill on some systems and is put here as added
+	// protection that the pin will not be in output state when it is un-exported in SysFS.
+	pin.Direction = "in"
+	pin.Enabled = false
+
+	return pin.backend.release()
 }
 
 // Set an output GPIO pin high
 func (pin *IOPin) SetHigh() error {
 	if pin.Enabled {
-		_, err := pin.SysfsFile.Write([]byte("1"))
-		if err != nil {
-			return err
-		}
+		return pin.backend.setHigh()
 	}
 	return nil
 }
@@ -214,10 +473,7 @@ func (pin *IOPin) SetHigh() error {
 // Set an output GPIO pin low
 func (pin *IOPin) SetLow() error {
 	if pin.Enabled {
-		_, err := pin.SysfsFile.Write([]byte("0"))
-		if err != nil {
-			return err
-		}
+		return pin.backend.setLow()
 	}
 	return nil
 }
@@ -225,54 +481,29 @@ func (pin *IOPin) SetLow() error {
 // Read an input GPIO pin and return 0 for low or 1 for high
 func (pin *IOPin) Read() (int, error) {
 	if pin.Enabled {
-		readBuffer := make([]byte, 1)
-		// Must rewind for every read
-		pin.SysfsFile.Seek(0, 0)
-		_, err := pin.SysfsFile.Read(readBuffer)
-		if err != nil {
-			return -1, err
-		}
-		state := int(readBuffer[0] & 1)
-		return state, nil
-	} else {
-		return -1, nil
+		return pin.backend.read()
 	}
+	return -1, nil
 }
 
-// Set up a GPIO pin to be both an input and an interrupt pin
+// AddPinInterrupt sets up a GPIO pin to be both an input and an interrupt pin, registering it with the default,
+// lazily-created Poller. Use a Poller directly if you need more than one independent epoll loop.
 func (pin *IOPin) AddPinInterrupt() error {
-	fdGpio := pin.SysfsFile
-
-	// Criteria: Input and edge-triggered
-	epollData.event.Events = syscall.EPOLLIN | EPOLLET
-	epollData.event.Fd = int32(fdGpio.Fd())
-	err := syscall.EpollCtl(epollData.fd, syscall.EPOLL_CTL_ADD, int(fdGpio.Fd()), &epollData.event)
-
+	p, err := defaultPoller()
 	if err != nil {
 		return err
 	}
-
-	return nil
+	return p.Add(pin)
 }
 
-// TODO: Finish and test this function
-
-// Remove the monitoring of a GPIO pin
+// DeletePinInterrupt removes a pin from the default Poller; it stops receiving interrupt events, but its sysfs or
+// cdev file descriptor is left open.
 func (pin *IOPin) DeletePinInterrupt() error {
-	fdGpio := pin.SysfsFile
-
-	fmt.Println("Before:", epollData.fd, int(fdGpio.Fd()), &epollData.event)
-
-	epollData.event.Fd = int32(fdGpio.Fd())
-	err := syscall.EpollCtl(epollData.fd, syscall.EPOLL_CTL_DEL, int(fdGpio.Fd()), &epollData.event)
-
-	fmt.Println("After:", epollData.fd, int(fdGpio.Fd()), &epollData.event)
-
+	p, err := defaultPoller()
 	if err != nil {
 		return err
 	}
-
-	return nil
+	return p.Remove(pin)
 }
 
 type InterruptData struct {
@@ -280,103 +511,16 @@ type InterruptData struct {
 	Edge        string
 	StateString string
 	// StateInt is unimplemented. I may consider taking this out.
-	StateInt    int
+	StateInt int
 }
 
-// Global variable used in init()
-var intStream <-chan InterruptData
-
+// GetInterruptStream returns the default Poller's shared stream of every registered pin's events. Prefer
+// IOPin.Subscribe for new code, since it gives each pin its own channel along with timestamps and a sequence
+// number.
 func GetInterruptStream() <-chan InterruptData {
-	return intStream
-}
-
-// Interrupt service routine by loose definition
-func isr() (interruptStream chan InterruptData) {
-
-	// Bidirectional channel returned by this function. This will be converted to a read-only channel in init().
-	interruptStream = make(chan InterruptData, MaxPollEvents)
-
-	// Spin the EpollWait() call off into a separate goroutine. If something happens, feed it into the channel.
-	go func() {
-		for {
-			// This call will block until the kernel has something ready
-			numEvents, err := syscall.EpollWait(epollData.fd, epollData.events[:], -1)
-
-			if err != nil {
-				fmt.Println("epoll_wait error ", err)
-			}
-
-			fmt.Println("numEvents: ", numEvents)
-			for ev := 0; ev < numEvents; ev++ {
-				ioPin := fileDescriptorMap[int32(epollData.events[ev].Fd)]
-				// Note: There is a possibility that this value can be wrong if the pin has been
-				// modified by another process. It is much faster to use the edge value already in
-				// this program's memory than to go back to SysFS and poll another file.
-				edge := ioPin.TriggerEdge
-				var stateString string
-				var stateInt int
-
-				if edge == "rising" {
-					stateString = "high"
-					stateInt = 1
-				} else if edge == "falling" {
-					stateString = "low"
-					stateInt = 0
-				} else if edge == "both" {
-					stateInt, _ = ioPin.Read()
-					if stateInt == 0 {
-						stateString = "low"
-					} else if stateInt == 1 {
-						stateString = "high"
-					}
-				} else if edge == "none" {
-				}
-
-				// Do not allow the channel to overflow
-				if len(interruptStream) != cap(interruptStream) {
-					interruptStream <- InterruptData{ioPin, edge, stateString, stateInt}
-				}
-			}
-		}
-	}()
-
-	return interruptStream
-}
-
-func init() {
-	// Create the map for referencing file descriptors to IOPins
-	fileDescriptorMap = make(map[int32]*IOPin, MaxIOPinCount)
-
-	// Initialize the epollData file descriptor here. It should be only initialized once per process.
-	var err error
-	epollData.fd, err = syscall.EpollCreate1(0)
-
+	p, err := defaultPoller()
 	if err != nil {
-		fmt.Println("epoll_create1 error: ", err)
+		return make(chan InterruptData)
 	}
-
-	intStream = isr()
-
-	// Handle SIGINT events
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	go func() {
-		for sig := range c {
-			fmt.Println("Interrupt signal received:", sig)
-
-			for _, pin := range fileDescriptorMap {
-				//				fmt.Println(pin)
-				pin.Enabled = false
-				err := pin.ReleasePin()
-
-				if err != nil {
-					fmt.Println("Error releasing pin upon program exit:", err)
-				}
-			}
-
-			fmt.Println("Pins have been released in SysFS.")
-
-			os.Exit(1)
-		}
-	}()
+	return p.InterruptStream()
 }
@@ -0,0 +1,315 @@
+/*
+Copyright (c) 2018 Forrest Sibley <My^Name^Without^The^Surname@ieee.org>
+
+Permission is hereby granted, free of charge, to any person obtaining
+a copy of this software and associated documentation files (the
+"Software"), to deal in the Software without restriction, including
+without limitation the rights to use, copy, modify, merge, publish,
+distribute, sublicense, and/or sell copies of the Software, and to
+permit persons to whom the Software is furnished to do so, subject to
+the following conditions:
+
+The above copyright notice and this permission notice shall be
+included in all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND
+NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE
+LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION
+WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package sysfsGPIO
+
+import (
+	"testing"
+	"time"
+)
+
+// withMemBackend installs a fresh MemBackend for the duration of a test and restores the real-filesystem Backend
+// afterwards, so tests never touch /sys/class/gpio.
+func withMemBackend(t *testing.T) *MemBackend {
+	t.Helper()
+	mem := NewMemBackend()
+	SetBackend(mem)
+	t.Cleanup(func() { SetBackend(nil) })
+	return mem
+}
+
+func TestInitPin(t *testing.T) {
+	cases := []struct {
+		name      string
+		direction string
+	}{
+		{"output", "out"},
+		{"input", "in"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mem := withMemBackend(t)
+
+			pin, err := InitPin(17, c.direction)
+			if err != nil {
+				t.Fatalf("InitPin: %v", err)
+			}
+			defer pin.ReleasePin()
+
+			if pin.SysfsFile != nil {
+				t.Error("SysfsFile should be nil when running against a MemBackend")
+			}
+			if got, ok := mem.Get("/sys/class/gpio/export"); !ok || got != "17" {
+				t.Errorf("export = %q, %v, want \"17\", true", got, ok)
+			}
+			if got, ok := mem.Get("/sys/class/gpio/gpio17/direction"); !ok || got != c.direction {
+				t.Errorf("direction = %q, %v, want %q, true", got, ok, c.direction)
+			}
+		})
+	}
+}
+
+func TestSetTriggerEdge(t *testing.T) {
+	cases := []struct {
+		edge    string
+		wantErr bool
+	}{
+		{"rising", false},
+		{"falling", false},
+		{"both", false},
+		{"none", false},
+		{"sideways", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.edge, func(t *testing.T) {
+			mem := withMemBackend(t)
+
+			pin, err := InitPin(17, "in")
+			if err != nil {
+				t.Fatalf("InitPin: %v", err)
+			}
+			defer pin.ReleasePin()
+
+			err = pin.SetTriggerEdge(c.edge)
+			if c.wantErr {
+				if err == nil {
+					t.Fatal("expected an error for an invalid trigger edge")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SetTriggerEdge: %v", err)
+			}
+
+			if got, ok := mem.Get("/sys/class/gpio/gpio17/edge"); !ok || got != c.edge {
+				t.Errorf("edge = %q, %v, want %q, true", got, ok, c.edge)
+			}
+		})
+	}
+}
+
+func TestSetHighSetLowRead(t *testing.T) {
+	withMemBackend(t)
+
+	out, err := InitPin(17, "out")
+	if err != nil {
+		t.Fatalf("InitPin: %v", err)
+	}
+	defer out.ReleasePin()
+
+	if err := out.SetHigh(); err != nil {
+		t.Fatalf("SetHigh: %v", err)
+	}
+	if got, err := out.Read(); err != nil || got != 1 {
+		t.Errorf("Read() = %d, %v, want 1, nil", got, err)
+	}
+
+	if err := out.SetLow(); err != nil {
+		t.Fatalf("SetLow: %v", err)
+	}
+	if got, err := out.Read(); err != nil || got != 0 {
+		t.Errorf("Read() = %d, %v, want 0, nil", got, err)
+	}
+
+	out.Enabled = false
+	if err := out.SetHigh(); err != nil {
+		t.Errorf("SetHigh on a disabled pin should be a no-op, got error: %v", err)
+	}
+	if got, err := out.Read(); err != nil || got != -1 {
+		t.Errorf("Read() on a disabled pin = %d, %v, want -1, nil", got, err)
+	}
+}
+
+func TestSetActiveLow(t *testing.T) {
+	mem := withMemBackend(t)
+
+	pin, err := InitPin(17, "out")
+	if err != nil {
+		t.Fatalf("InitPin: %v", err)
+	}
+	defer pin.ReleasePin()
+
+	if err := pin.SetActiveLow(true); err != nil {
+		t.Fatalf("SetActiveLow(true): %v", err)
+	}
+	if got, ok := mem.Get("/sys/class/gpio/gpio17/active_low"); !ok || got != "1" {
+		t.Errorf("active_low = %q, %v, want \"1\", true", got, ok)
+	}
+
+	if err := pin.SetActiveLow(false); err != nil {
+		t.Fatalf("SetActiveLow(false): %v", err)
+	}
+	if got, ok := mem.Get("/sys/class/gpio/gpio17/active_low"); !ok || got != "0" {
+		t.Errorf("active_low = %q, %v, want \"0\", true", got, ok)
+	}
+}
+
+// SetBias and SetDrive are only implemented by the cdev backend; a sysfs pin (the only kind InitPin can create)
+// must report that they are unsupported rather than silently doing nothing.
+func TestSetBiasDriveUnsupportedOnSysfs(t *testing.T) {
+	withMemBackend(t)
+
+	pin, err := InitPin(17, "out")
+	if err != nil {
+		t.Fatalf("InitPin: %v", err)
+	}
+	defer pin.ReleasePin()
+
+	if err := pin.SetBias(BiasPullUp); err == nil {
+		t.Error("SetBias should return an error on the sysfs backend")
+	}
+	if err := pin.SetDrive(DriveOpenDrain); err == nil {
+		t.Error("SetDrive should return an error on the sysfs backend")
+	}
+}
+
+// TestSetDebounce exercises the debounce window enforced in Poller.dispatchOne: a second edge arriving before the
+// window elapses must be dropped, and one arriving after it must be accepted.
+func TestSetDebounce(t *testing.T) {
+	withMemBackend(t)
+
+	in, err := InitPin(27, "in")
+	if err != nil {
+		t.Fatalf("InitPin: %v", err)
+	}
+	defer in.ReleasePin()
+
+	if err := in.SetTriggerEdge("rising"); err != nil {
+		t.Fatalf("SetTriggerEdge: %v", err)
+	}
+	in.SetDebounce(50 * time.Millisecond)
+
+	p, err := NewPoller()
+	if err != nil {
+		t.Fatalf("NewPoller: %v", err)
+	}
+	defer p.Close()
+
+	if err := p.Add(in); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	defer p.Remove(in)
+
+	events, unsubscribe := in.Subscribe()
+	defer unsubscribe()
+
+	p.InjectEdge(in) // accepted
+	p.InjectEdge(in) // within the debounce window: should be dropped
+
+	select {
+	case ev := <-events:
+		if ev.Seq != 1 {
+			t.Fatalf("first event Seq = %d, want 1", ev.Seq)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the first event")
+	}
+
+	select {
+	case ev := <-events:
+		t.Fatalf("expected the second InjectEdge within the debounce window to be dropped, got %+v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	time.Sleep(60 * time.Millisecond) // past the debounce window
+	p.InjectEdge(in)                  // accepted again
+
+	select {
+	case ev := <-events:
+		if ev.Seq != 2 {
+			t.Fatalf("third event Seq = %d, want 2", ev.Seq)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the third event")
+	}
+}
+
+func TestAddDeletePinInterrupt(t *testing.T) {
+	withMemBackend(t)
+
+	in, err := InitPin(27, "in")
+	if err != nil {
+		t.Fatalf("InitPin: %v", err)
+	}
+	defer in.ReleasePin()
+
+	if err := in.AddPinInterrupt(); err != nil {
+		t.Fatalf("AddPinInterrupt: %v", err)
+	}
+	if err := in.DeletePinInterrupt(); err != nil {
+		t.Fatalf("DeletePinInterrupt: %v", err)
+	}
+}
+
+func TestPollerEdgeDispatch(t *testing.T) {
+	withMemBackend(t)
+
+	in, err := InitPin(27, "in")
+	if err != nil {
+		t.Fatalf("InitPin: %v", err)
+	}
+	defer in.ReleasePin()
+
+	if err := in.SetTriggerEdge("rising"); err != nil {
+		t.Fatalf("SetTriggerEdge: %v", err)
+	}
+
+	p, err := NewPoller()
+	if err != nil {
+		t.Fatalf("NewPoller: %v", err)
+	}
+	defer p.Close()
+
+	if err := p.Add(in); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	defer p.Remove(in)
+
+	events, unsubscribe := in.Subscribe()
+	defer unsubscribe()
+
+	p.InjectEdge(in)
+
+	select {
+	case ev := <-events:
+		if ev.Edge != "rising" || ev.StateString != "high" || ev.StateInt != 1 {
+			t.Errorf("event = %+v, want Edge=rising StateString=high StateInt=1", ev)
+		}
+		if ev.Seq != 1 {
+			t.Errorf("Seq = %d, want 1", ev.Seq)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the injected edge event")
+	}
+
+	select {
+	case data := <-p.InterruptStream():
+		if data.IOPin != in {
+			t.Errorf("InterruptData.IOPin = %v, want %v", data.IOPin, in)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the injected edge event on the Poller's InterruptStream")
+	}
+}